@@ -6,6 +6,7 @@ import (
 
 type CircularFrameBuffer struct {
 	frameBuffer []gocv.Mat // Frames slice
+	grayBuffer  []gocv.Mat // Grayscale version of each frameBuffer entry, cached on Enqueue
 	frozenFrame gocv.Mat   // Last freeze frame
 	blendOffset int        // Number of frames to delay when blending
 	size        int        // frameBuffer capacity
@@ -19,14 +20,16 @@ func NewCircularFrameBuffer(size, blendOffset int) *CircularFrameBuffer {
 	// Create new CircularFrameBuffer struct
 	cfb := CircularFrameBuffer{
 		frameBuffer: make([]gocv.Mat, size),
+		grayBuffer:  make([]gocv.Mat, size),
 		frozenFrame: gocv.NewMat(),
 		blendOffset: blendOffset,
 		size:        size,
 	}
 
-	// Prepopulate frameBuffer with new empty Mats
+	// Prepopulate frameBuffer and grayBuffer with new empty Mats
 	for i := range cfb.frameBuffer {
 		cfb.frameBuffer[i] = gocv.NewMat()
+		cfb.grayBuffer[i] = gocv.NewMat()
 	}
 
 	return &cfb
@@ -63,6 +66,21 @@ func (cfb *CircularFrameBuffer) CalcBlendFrame() gocv.Mat {
 	return cfb.frameBuffer[blendFrameIdx]
 }
 
+// BaseGrayFrame returns the cached grayscale version of BaseFrame, used as
+// one of the two inputs to optical-flow motion mode.
+func (cfb *CircularFrameBuffer) BaseGrayFrame() gocv.Mat {
+	baseFrameIdx := (cfb.tail - 1 + cfb.size) % cfb.size
+
+	return cfb.grayBuffer[baseFrameIdx]
+}
+
+// BlendGrayFrame returns the cached grayscale version of CalcBlendFrame's
+// delayed frame, used as the "previous" frame for optical-flow motion mode.
+func (cfb *CircularFrameBuffer) BlendGrayFrame() gocv.Mat {
+	blendFrameIdx := (cfb.tail - cfb.blendOffset + cfb.size) % cfb.size
+	return cfb.grayBuffer[blendFrameIdx]
+}
+
 // Toggle FreezeFrame mode
 // In this mode BlendFrame would returns frozenFrame
 func (cfb *CircularFrameBuffer) ToggleFreezeFrame() bool {
@@ -96,12 +114,40 @@ func (cfb *CircularFrameBuffer) DecBlendOffset() int {
 	return cfb.blendOffset
 }
 
+// SetBlendOffset sets blendOffset directly, clamping it to
+// [minBlendOffset, maxBlendOffset]. Used by callers (e.g. the HTTP remote
+// control endpoints) that supply an absolute offset rather than
+// incrementing/decrementing it one frame at a time.
+func (cfb *CircularFrameBuffer) SetBlendOffset(offset int) int {
+	if offset < minBlendOffset {
+		offset = minBlendOffset
+	} else if offset > maxBlendOffset {
+		offset = maxBlendOffset
+	}
+
+	cfb.blendOffset = offset
+
+	return cfb.blendOffset
+}
+
+// Enqueue appends frame as the new tail, evicting (Dequeue-ing, which closes
+// it) the oldest frame first if the buffer is already full. Enqueue always
+// succeeds: CircularFrameBuffer is a true ring buffer, not a bounded queue
+// that can reject writes, so there's never a reason for the caller to drop
+// or leak frame.
 func (cfb *CircularFrameBuffer) Enqueue(frame gocv.Mat) bool {
 	if cfb.full {
-		return false
+		cfb.Dequeue()
 	}
 
 	cfb.frameBuffer[cfb.tail] = frame
+
+	// Convert to grayscale once here so flow mode doesn't have to redo it
+	// for every frame it considers.
+	gray := gocv.NewMat()
+	gocv.CvtColor(frame, &gray, gocv.ColorBGRToGray)
+	cfb.grayBuffer[cfb.tail] = gray
+
 	cfb.tail = (cfb.tail + 1) % cfb.size
 	cfb.full = cfb.tail == cfb.head
 
@@ -114,9 +160,11 @@ func (cfb *CircularFrameBuffer) Dequeue() bool {
 	}
 
 	frame := cfb.frameBuffer[cfb.head]
+	gray := cfb.grayBuffer[cfb.head]
 	cfb.head = (cfb.head + 1) % cfb.size
 	cfb.full = false
 	frame.Close()
+	gray.Close()
 
 	return true
 }
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// BlendController serializes access to a CircularFrameBuffer's mutable blend
+// controls so they can be driven concurrently from the keyboard handler and
+// from HTTP requests in --stream mode.
+type BlendController struct {
+	mu          sync.Mutex
+	frameBuffer *CircularFrameBuffer
+	flowMode    bool // whether to render the optical-flow motion mask instead of invert-blend
+}
+
+func NewBlendController(frameBuffer *CircularFrameBuffer) *BlendController {
+	return &BlendController{frameBuffer: frameBuffer}
+}
+
+func (bc *BlendController) IncBlendOffset() int {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	return bc.frameBuffer.IncBlendOffset()
+}
+
+func (bc *BlendController) DecBlendOffset() int {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	return bc.frameBuffer.DecBlendOffset()
+}
+
+func (bc *BlendController) SetBlendOffset(offset int) int {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	return bc.frameBuffer.SetBlendOffset(offset)
+}
+
+func (bc *BlendController) BlendOffset() int {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	return bc.frameBuffer.blendOffset
+}
+
+func (bc *BlendController) ToggleFreezeFrame() bool {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	return bc.frameBuffer.ToggleFreezeFrame()
+}
+
+func (bc *BlendController) IsFrozen() bool {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	return bc.frameBuffer.IsFrozen()
+}
+
+// ToggleFlowMode switches between invert-blend mode and optical-flow
+// motion-mask mode, returning the new state.
+func (bc *BlendController) ToggleFlowMode() bool {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	bc.flowMode = !bc.flowMode
+	return bc.flowMode
+}
+
+func (bc *BlendController) FlowMode() bool {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+	return bc.flowMode
+}
+
+// RegisterHandlers wires the remote-control endpoints onto mux so a headless
+// deployment (e.g. a Raspberry Pi with --stream but no keyboard) can drive
+// the same controls as the local "A"/"D"/Space/"F" keys.
+func (bc *BlendController) RegisterHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/blend", bc.handleBlend)
+	mux.HandleFunc("/freeze", bc.handleFreeze)
+	mux.HandleFunc("/flow", bc.handleFlow)
+}
+
+func (bc *BlendController) handleBlend(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	offset, err := strconv.Atoi(r.URL.Query().Get("offset"))
+	if err != nil {
+		http.Error(w, "invalid or missing offset", http.StatusBadRequest)
+		return
+	}
+
+	fmt.Fprintf(w, "blendOffset=%d\n", bc.SetBlendOffset(offset))
+}
+
+func (bc *BlendController) handleFreeze(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	fmt.Fprintf(w, "frozen=%t\n", bc.ToggleFreezeFrame())
+}
+
+func (bc *BlendController) handleFlow(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	fmt.Fprintf(w, "flowMode=%t\n", bc.ToggleFlowMode())
+}
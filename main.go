@@ -1,15 +1,21 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"image"
 	"image/color"
 	"log"
 	"math"
+	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"sync"
+	"syscall"
 	"time"
 
+	"github.com/hybridgroup/mjpeg"
 	"gocv.io/x/gocv"
 )
 
@@ -23,125 +29,168 @@ const (
 
 var HUDColor = color.RGBA{0, 255, 0, 0}
 
+var (
+	streamAddr = flag.String("stream", "", "serve an MJPEG stream of the blended frame on this host:port (e.g. :8080)")
+	headless   = flag.Bool("headless", false, "do not open a local display window; for use with -stream on headless deployments")
+
+	flowMode      = flag.Bool("flow", false, "start in optical-flow motion-mask mode instead of invert-blend mode (toggle at runtime with F)")
+	flowHeatmap   = flag.Bool("flow-heatmap", false, "render the optical-flow mask as a heatmap instead of compositing it over the original frame")
+	flowThreshold = flag.Float64("flow-threshold", 2.0, "flow magnitude threshold used to build the motion mask")
+
+	flowPyrScale   = flag.Float64("flow-pyr-scale", 0.5, "Farneback optical flow pyrScale parameter")
+	flowLevels     = flag.Int("flow-levels", 2, "Farneback optical flow levels parameter")
+	flowWinsize    = flag.Int("flow-winsize", 5, "Farneback optical flow winsize parameter")
+	flowIterations = flag.Int("flow-iterations", 2, "Farneback optical flow iterations parameter")
+	flowPolyN      = flag.Int("flow-poly-n", 5, "Farneback optical flow polyN parameter")
+	flowPolySigma  = flag.Float64("flow-poly-sigma", 1.1, "Farneback optical flow polySigma parameter")
+
+	recordPath   = flag.String("record", "", "record the blended output to this video file (e.g. out.avi)")
+	recordFourCC = flag.String("record-fourcc", "MJPG", "FourCC codec used for -record")
+
+	motionThreshold = flag.Float64("motion-threshold", 12.0, "mean abs-diff energy above which a frame counts as motion")
+	motionFrames    = flag.Int("motion-frames", 3, "number of consecutive above-threshold frames required to fire a motion event")
+	motionCooldown  = flag.Duration("motion-cooldown", 10*time.Second, "minimum time between motion events")
+	motionNotify    = flag.String("motion-notify", "", "comma-separated notifiers to fire on motion, e.g. log,file:./snaps,webhook:https://example.com/hook")
+)
+
 func main() {
 	// defer profile.Start(profile.MemProfile).Stop()
 
-	if len(os.Args) < 2 {
-		fmt.Println("How to run:\n\n\tgosvm [camera ID]")
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		fmt.Println("How to run:\n\n\tgosvm [flags] [camera ID | video file]\n")
+		flag.PrintDefaults()
 		return
 	}
 
-	// Parse args
-	deviceID, _ := strconv.Atoi(os.Args[1])
+	// Parse args. A source that parses as an integer is a camera device ID;
+	// anything else is treated as a path to a video file to batch-process.
+	source := flag.Arg(0)
 
-	// Try to open video capture device
-	webcam, err := gocv.VideoCaptureDevice(int(deviceID))
+	var webcam *gocv.VideoCapture
+	var err error
+	if deviceID, convErr := strconv.Atoi(source); convErr == nil {
+		webcam, err = gocv.VideoCaptureDevice(deviceID)
+		if err == nil {
+			fmt.Printf("Start reading from camera device: %v\n", deviceID)
+		}
+	} else {
+		webcam, err = gocv.VideoCaptureFile(source)
+		if err == nil {
+			fmt.Printf("Start reading from video file: %v\n", source)
+		}
+	}
 	if err != nil {
 		fmt.Println(err)
 		return
 	}
 	defer webcam.Close()
 
-	// Open display window
-	window := gocv.NewWindow("Motion Extraction")
-	defer window.Close()
+	// The -record writer is opened lazily by the display stage, once the
+	// first blended frame's dimensions are known.
+	recordFPS := webcam.Get(gocv.VideoCaptureFPS)
+	if recordFPS <= 0 {
+		recordFPS = 30
+	}
+	record := recordConfig{path: *recordPath, fourcc: *recordFourCC, fps: recordFPS}
+
+	// Open display window, unless running headless (e.g. on a Raspberry Pi)
+	var window *gocv.Window
+	if !*headless {
+		window = gocv.NewWindow("Motion Extraction")
+		defer window.Close()
+	}
 
 	// Initialize CircularFrameBuffer to hold past frames
 	frameBuffer := NewCircularFrameBuffer(frameBufferSize, defaultBlendOffset)
 
-	// Initialize FPS calculator
-	fpsCalculator := NewFPSCalculator()
-
-	fmt.Printf("Start reading from camera device: %v\n", deviceID)
-
-	// Main program loop
-	for {
-		// Initialize and read current frame from device
-		currentFrame := gocv.NewMat()
-
-		if !ReadWebcamWithRetry(webcam, &currentFrame, maxCameraRetries) {
-			log.Fatal("Failed to read from webcam after multiple attempts")
-			break
-		}
-
-		if currentFrame.Empty() {
-			currentFrame.Close()
-			break
-		}
-
-		// Close the Mat at the current buffer position to avoid memory leaks
-		// if frameBuffer[currentIndex].Empty() == false {
-		// 	frameBuffer[currentIndex].Close()
-		// }
-
-		// Denoise currentFrame
-		// gocv.FastNlMeansDenoisingColoredWithParams(currentFrame, &currentFrame, 28.0, 12.0, 12, 7)
-
-		// Enqueue the current frame in the buffer
-		if !frameBuffer.Enqueue(currentFrame.Clone()) {
-			log.Fatal("CircularFrameBuffer is full")
-		}
-
-		currentFrame.Close()
-
-		blendFrame := frameBuffer.CalcBlendFrame()
+	// BlendController lets both the local keyboard handler and, when
+	// -stream is set, the HTTP endpoints drive the frame buffer's blend
+	// controls without racing each other.
+	controller := NewBlendController(frameBuffer)
+	if *flowMode {
+		controller.ToggleFlowMode()
+	}
 
-		if !blendFrame.Empty() {
-			// Calculate base frame
-			baseFrame := frameBuffer.BaseFrame()
+	farnebackParams := FarnebackParams{
+		PyrScale:   *flowPyrScale,
+		Levels:     *flowLevels,
+		Winsize:    *flowWinsize,
+		Iterations: *flowIterations,
+		PolyN:      *flowPolyN,
+		PolySigma:  *flowPolySigma,
+	}
 
-			// Create a half-transparent inverted version of the blending frame
-			halfTransparentFrame := gocv.NewMat()
+	// Initialize FPS calculator
+	fpsCalculator := NewFPSCalculator()
 
-			// Invert current frame
-			gocv.BitwiseNot(blendFrame, &halfTransparentFrame)
-			gocv.AddWeighted(halfTransparentFrame, 0.5, baseFrame, 0.0, 0, &halfTransparentFrame)
+	// Wire up motion-triggered notifications, if any notifiers were requested.
+	notifiers, err := parseNotifiers(*motionNotify)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-			// Blend the current frame with the delayed frame
-			blendedFrame := gocv.NewMat()
+	var motionDetector *MotionDetector
+	if len(notifiers) > 0 {
+		motionDetector = NewMotionDetector(*motionThreshold, *motionFrames, *motionCooldown)
+	}
 
-			blendFrames(baseFrame, halfTransparentFrame, &blendedFrame, 0.4)
+	// When -stream is set, publish the blended frame as an MJPEG feed and
+	// expose remote control endpoints for deployments with no local display.
+	var stream *mjpeg.Stream
+	if *streamAddr != "" {
+		stream = mjpeg.NewStream()
 
-			// Apply emobss effect
-			// applyEmbossEffect(blendedFrame, &blendedFrame)
+		mux := http.NewServeMux()
+		mux.Handle("/", stream)
+		controller.RegisterHandlers(mux)
 
-			// Calculate FPS
-			if fpsCalculator != nil {
-				fps := fpsCalculator.calculateFPS()
-				gocv.PutText(&blendedFrame,
-					fmt.Sprintf("FPS: %.2f, Delay: %d (A/D keys to inc/dec), Freeze: %t",
-						fps,
-						frameBuffer.blendOffset,
-						frameBuffer.IsFrozen()),
-					image.Pt(10, 40),
-					gocv.FontHersheyPlain, 1.9, HUDColor, 2)
+		go func() {
+			log.Printf("Serving MJPEG stream on http://%s\n", *streamAddr)
+			if err := http.ListenAndServe(*streamAddr, mux); err != nil {
+				log.Fatal(err)
 			}
-
-			// Display the resulting frame in the window
-			window.IMShow(blendedFrame)
-
-			// Close Mats manualy
-			blendedFrame.Close()
-			halfTransparentFrame.Close()
-		}
-
-		// Move to the next index in the circular buffer
-		// frameBuffer.Dequeue()
-
-		// Handle user input to change the blend offset
-		key := window.WaitKey(10)
-		if key == 27 || key == 113 { // ESC or Q key to exit
-			break
-		} else if key == 97 { // "A" key decreses blendOffset
-			frameBuffer.DecBlendOffset()
-		} else if key == 100 { // "D" key increses blendOffset
-			frameBuffer.IncBlendOffset()
-		} else if key == 32 { // Spacebar key to togle freeze frame
-			frameBuffer.ToggleFreezeFrame()
-		}
-
-		time.Sleep(30 * time.Millisecond)
+		}()
 	}
+
+	// Wire up the capture -> process -> display pipeline. Each stage runs
+	// concurrently so a slow frame in one stage doesn't stall the others;
+	// done is closed (via quit) to unwind capture/process on quit.
+	pool := NewMatPool()
+	done := make(chan struct{})
+	captureCh := make(chan *gocv.Mat, pipelineChanBuffer)
+	displayCh := make(chan *gocv.Mat, pipelineChanBuffer)
+
+	// quit closes done exactly once, however it's triggered: the ESC/Q key in
+	// displayStage, or SIGINT/SIGTERM below. The latter is what lets a
+	// --headless -record run against a live camera (no window, no HTTP
+	// control endpoint) shut down gracefully instead of only via a kill that
+	// would truncate the recording.
+	var quitOnce sync.Once
+	quit := func() { quitOnce.Do(func() { close(done) }) }
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigCh
+		quit()
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go captureStage(webcam, pool, captureCh, done, &wg)
+	go processStage(frameBuffer, controller, farnebackParams, float32(*flowThreshold), *flowHeatmap,
+		motionDetector, notifiers, pool, captureCh, displayCh, done, &wg)
+
+	// displayStage runs on the main goroutine: it owns the window and blocks
+	// until the capture/process stages finish or the user quits.
+	displayStage(window, stream, record, fpsCalculator, controller, pool, displayCh, quit)
+
+	// Wait for capture/process to actually stop touching webcam before the
+	// deferred webcam.Close()/window.Close() run; otherwise a goroutine
+	// blocked inside webcam.Read() could race a concurrent Close() on quit.
+	wg.Wait()
 }
 
 // ReadWithRetry attempts to read from the webcam with exponential backoff retries
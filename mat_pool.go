@@ -0,0 +1,51 @@
+package main
+
+import (
+	"gocv.io/x/gocv"
+)
+
+// matPoolCapacity bounds how many Mats MatPool holds onto. This needs to
+// cover the handful of frames that can be in flight across the pipeline's
+// channels and scratch Mats at once; anything beyond that is closed
+// immediately rather than handed to the pool.
+const matPoolCapacity = 16
+
+// MatPool recycles gocv.Mats so the pipeline doesn't pay for a CGO
+// alloc/free on every frame. Mats returned by Get have undefined prior
+// contents; callers overwrite them via the usual gocv out-param calls
+// (e.g. gocv.BitwiseNot(src, &dst)) rather than relying on a zeroed Mat.
+//
+// This is deliberately not a sync.Pool: sync.Pool silently drops items
+// across GC cycles with no way to run cleanup, and a dropped gocv.Mat leaks
+// its CGO-allocated buffer forever since Mat has no finalizer. A bounded
+// channel lets Put close a Mat outright when the pool is full instead of
+// losing track of it.
+type MatPool struct {
+	mats chan *gocv.Mat
+}
+
+func NewMatPool() *MatPool {
+	return &MatPool{mats: make(chan *gocv.Mat, matPoolCapacity)}
+}
+
+// Get returns a Mat ready for reuse as scratch space, allocating a new one
+// if the pool is empty.
+func (p *MatPool) Get() *gocv.Mat {
+	select {
+	case mat := <-p.mats:
+		return mat
+	default:
+		m := gocv.NewMat()
+		return &m
+	}
+}
+
+// Put returns mat to the pool for reuse, or closes it if the pool is full.
+// The caller must not use mat again after calling Put.
+func (p *MatPool) Put(mat *gocv.Mat) {
+	select {
+	case p.mats <- mat:
+	default:
+		mat.Close()
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"time"
+
+	"gocv.io/x/gocv"
+)
+
+// MotionDetector turns a stream of per-frame motion energy readings into
+// debounced motion events: energy must stay above threshold for
+// consecutiveFrames in a row before an event fires, and firing again is
+// suppressed until cooldown has elapsed.
+type MotionDetector struct {
+	threshold         float64
+	consecutiveFrames int
+	cooldown          time.Duration
+
+	aboveCount int
+	lastFired  time.Time
+}
+
+func NewMotionDetector(threshold float64, consecutiveFrames int, cooldown time.Duration) *MotionDetector {
+	return &MotionDetector{
+		threshold:         threshold,
+		consecutiveFrames: consecutiveFrames,
+		cooldown:          cooldown,
+	}
+}
+
+// Energy computes the motion energy between two frames as the mean
+// grayscale absolute pixel difference.
+func (md *MotionDetector) Energy(baseFrame, blendFrame gocv.Mat) float64 {
+	diff := gocv.NewMat()
+	defer diff.Close()
+	gocv.AbsDiff(baseFrame, blendFrame, &diff)
+
+	gray := gocv.NewMat()
+	defer gray.Close()
+	gocv.CvtColor(diff, &gray, gocv.ColorBGRToGray)
+
+	return gray.Mean().Val1
+}
+
+// Update feeds the current energy reading through the debounce logic and
+// reports whether a motion event should fire now.
+func (md *MotionDetector) Update(energy float64) bool {
+	if energy < md.threshold {
+		md.aboveCount = 0
+		return false
+	}
+
+	md.aboveCount++
+	if md.aboveCount < md.consecutiveFrames {
+		return false
+	}
+
+	if !md.lastFired.IsZero() && time.Since(md.lastFired) < md.cooldown {
+		return false
+	}
+
+	md.lastFired = time.Now()
+	md.aboveCount = 0
+	return true
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gocv.io/x/gocv"
+)
+
+// Notifier is notified whenever the MotionDetector fires a motion event.
+type Notifier interface {
+	OnMotion(ctx context.Context, snapshot gocv.Mat, score float64) error
+}
+
+// LogNotifier logs motion events to stdout.
+type LogNotifier struct{}
+
+func NewLogNotifier() *LogNotifier {
+	return &LogNotifier{}
+}
+
+func (n *LogNotifier) OnMotion(ctx context.Context, snapshot gocv.Mat, score float64) error {
+	log.Printf("Motion detected: score=%.2f\n", score)
+	return nil
+}
+
+// FileNotifier saves a timestamped JPEG snapshot to dir for each motion event.
+type FileNotifier struct {
+	dir string
+}
+
+func NewFileNotifier(dir string) *FileNotifier {
+	return &FileNotifier{dir: dir}
+}
+
+func (n *FileNotifier) OnMotion(ctx context.Context, snapshot gocv.Mat, score float64) error {
+	if err := os.MkdirAll(n.dir, 0o755); err != nil {
+		return fmt.Errorf("creating snapshot directory: %w", err)
+	}
+
+	buf, err := gocv.IMEncode(gocv.JPEGFileExt, snapshot)
+	if err != nil {
+		return fmt.Errorf("encoding snapshot: %w", err)
+	}
+	defer buf.Close()
+
+	path := filepath.Join(n.dir, fmt.Sprintf("motion-%s.jpg", time.Now().Format("20060102-150405.000")))
+
+	return os.WriteFile(path, buf.GetBytes(), 0o644)
+}
+
+// WebhookNotifier POSTs a motion snapshot as multipart/form-data to url.
+type WebhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{url: url, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (n *WebhookNotifier) OnMotion(ctx context.Context, snapshot gocv.Mat, score float64) error {
+	buf, err := gocv.IMEncode(gocv.JPEGFileExt, snapshot)
+	if err != nil {
+		return fmt.Errorf("encoding snapshot: %w", err)
+	}
+	defer buf.Close()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+
+	if err := mw.WriteField("score", fmt.Sprintf("%.4f", score)); err != nil {
+		return err
+	}
+
+	part, err := mw.CreateFormFile("snapshot", "snapshot.jpg")
+	if err != nil {
+		return err
+	}
+	if _, err := part.Write(buf.GetBytes()); err != nil {
+		return err
+	}
+	if err := mw.Close(); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %s returned status %s", n.url, resp.Status)
+	}
+
+	return nil
+}
+
+// parseNotifiers parses a comma-separated -motion-notify spec like
+// "log,file:./snaps,webhook:https://example.com/hook" into Notifiers.
+func parseNotifiers(spec string) ([]Notifier, error) {
+	if spec == "" {
+		return nil, nil
+	}
+
+	var notifiers []Notifier
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		kind, arg, _ := strings.Cut(entry, ":")
+
+		switch kind {
+		case "log":
+			notifiers = append(notifiers, NewLogNotifier())
+		case "file":
+			if arg == "" {
+				return nil, fmt.Errorf("invalid -motion-notify entry %q: file notifier requires a directory", entry)
+			}
+			notifiers = append(notifiers, NewFileNotifier(arg))
+		case "webhook":
+			if arg == "" {
+				return nil, fmt.Errorf("invalid -motion-notify entry %q: webhook notifier requires a URL", entry)
+			}
+			notifiers = append(notifiers, NewWebhookNotifier(arg))
+		default:
+			return nil, fmt.Errorf("unknown -motion-notify kind %q", kind)
+		}
+	}
+
+	return notifiers, nil
+}
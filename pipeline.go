@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/hybridgroup/mjpeg"
+	"gocv.io/x/gocv"
+)
+
+// The capture, process and display stages run as separate goroutines
+// connected by buffered channels so a slow processing frame doesn't force
+// the capture goroutine to sit idle waiting on WaitKey, and vice versa.
+//
+// Ownership contract: a Mat sent on a channel transfers ownership to the
+// receiving stage. The receiver is the one that returns it to the MatPool
+// (via pool.Put) once it no longer needs it; a Mat must never be read after
+// it has been sent on a channel or put back in the pool.
+const pipelineChanBuffer = 4
+
+// recordConfig holds the -record settings needed to lazily open the output
+// video writer once the first blended frame's dimensions are known.
+type recordConfig struct {
+	path   string
+	fourcc string
+	fps    float64
+}
+
+// captureStage owns webcam and pushes newly read frames downstream, one Mat
+// (borrowed from pool) per iteration. It stops, closing out, on read
+// failure, end of stream, or when done is closed. wg.Done is called on
+// exit so main can wait for the goroutine to stop touching webcam before
+// closing it.
+func captureStage(webcam *gocv.VideoCapture, pool *MatPool, out chan<- *gocv.Mat, done <-chan struct{}, wg *sync.WaitGroup) {
+	defer wg.Done()
+	defer close(out)
+
+	for {
+		frame := pool.Get()
+
+		if !ReadWebcamWithRetry(webcam, frame, maxCameraRetries) {
+			log.Println("Failed to read from webcam after multiple attempts")
+			pool.Put(frame)
+			return
+		}
+
+		if frame.Empty() {
+			pool.Put(frame)
+			return
+		}
+
+		select {
+		case out <- frame:
+		case <-done:
+			pool.Put(frame)
+			return
+		}
+	}
+}
+
+// processStage owns frameBuffer, turning each captured frame into a blended
+// (or flow-mask) frame pushed downstream. The blend controls are changed
+// through controller from other goroutines, so each frame is processed while
+// holding controller's lock; the lock is released before sending downstream.
+// Captured frames are cloned into frameBuffer, which keeps its own
+// independently-owned copies; the pool-borrowed capture Mat is returned to
+// pool immediately after cloning. When motionDetector is non-nil, it also
+// feeds frameBuffer's base/blend frames through it and fires notifiers on a
+// detected motion event, without blocking the pipeline on notifier I/O.
+// wg.Done is called on exit so main can wait for the goroutine to finish.
+func processStage(frameBuffer *CircularFrameBuffer, controller *BlendController, params FarnebackParams,
+	flowThreshold float32, flowHeatmap bool, motionDetector *MotionDetector, notifiers []Notifier,
+	pool *MatPool, in <-chan *gocv.Mat, out chan<- *gocv.Mat, done <-chan struct{}, wg *sync.WaitGroup) {
+	defer wg.Done()
+	defer close(out)
+
+	for frame := range in {
+		controller.mu.Lock()
+		frameBuffer.Enqueue(frame.Clone())
+		pool.Put(frame)
+
+		blendFrame := frameBuffer.CalcBlendFrame()
+		if blendFrame.Empty() {
+			controller.mu.Unlock()
+			continue
+		}
+
+		baseFrame := frameBuffer.BaseFrame()
+
+		if motionDetector != nil {
+			energy := motionDetector.Energy(baseFrame, blendFrame)
+			if motionDetector.Update(energy) {
+				fireNotifiers(notifiers, baseFrame.Clone(), energy)
+			}
+		}
+
+		blendedFrame := pool.Get()
+
+		if controller.flowMode {
+			mask := calcFlowMask(frameBuffer.BlendGrayFrame(), frameBuffer.BaseGrayFrame(), params, flowThreshold)
+
+			if flowHeatmap {
+				renderFlowHeatmap(mask, blendedFrame)
+			} else {
+				renderFlowOverlay(baseFrame, mask, blendedFrame, 0.5)
+			}
+
+			mask.Close()
+		} else {
+			halfTransparentFrame := pool.Get()
+
+			gocv.BitwiseNot(blendFrame, halfTransparentFrame)
+			gocv.AddWeighted(*halfTransparentFrame, 0.5, baseFrame, 0.0, 0, halfTransparentFrame)
+
+			blendFrames(baseFrame, *halfTransparentFrame, blendedFrame, 0.4)
+
+			pool.Put(halfTransparentFrame)
+		}
+		controller.mu.Unlock()
+
+		select {
+		case out <- blendedFrame:
+		case <-done:
+			pool.Put(blendedFrame)
+			return
+		}
+	}
+}
+
+// fireNotifiers runs the notifiers one after another against snapshot in a
+// separate goroutine so a slow or unreachable webhook can never stall the
+// processing pipeline.
+// snapshot is closed once every notifier has run.
+func fireNotifiers(notifiers []Notifier, snapshot gocv.Mat, score float64) {
+	go func() {
+		defer snapshot.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		for _, n := range notifiers {
+			if err := n.OnMotion(ctx, snapshot, score); err != nil {
+				log.Printf("motion notifier error: %v\n", err)
+			}
+		}
+	}()
+}
+
+// displayStage owns the display window, the MJPEG stream and the output
+// video writer. It runs on the calling goroutine (the pipeline's final
+// consumer) until in is closed or the user quits. When the user quits it
+// calls quit so the upstream stages unwind too; on either exit the deferred
+// writer.Close() below runs instead of leaving the recording truncated.
+func displayStage(window *gocv.Window, stream *mjpeg.Stream, record recordConfig, fpsCalculator *FPSCalculator,
+	controller *BlendController, pool *MatPool, in <-chan *gocv.Mat, quit func()) {
+	var writer *gocv.VideoWriter
+	defer func() {
+		if writer != nil {
+			writer.Close()
+		}
+	}()
+
+	for frame := range in {
+		if fpsCalculator != nil {
+			fps := fpsCalculator.calculateFPS()
+			gocv.PutText(frame,
+				fmt.Sprintf("FPS: %.2f, Delay: %d (A/D keys to inc/dec), Freeze: %t, Flow: %t (F to toggle)",
+					fps,
+					controller.BlendOffset(),
+					controller.IsFrozen(),
+					controller.FlowMode()),
+				image.Pt(10, 40),
+				gocv.FontHersheyPlain, 1.9, HUDColor, 2)
+		}
+
+		if record.path != "" {
+			if writer == nil {
+				var err error
+				writer, err = gocv.VideoWriterFile(record.path, record.fourcc, record.fps, frame.Cols(), frame.Rows(), true)
+				if err != nil {
+					log.Fatalf("Failed to open -record output %q: %v", record.path, err)
+				}
+			}
+
+			if err := writer.Write(*frame); err != nil {
+				log.Printf("Failed to write frame to %q: %v\n", record.path, err)
+			}
+		}
+
+		if window != nil {
+			window.IMShow(*frame)
+		}
+
+		if stream != nil {
+			buf, err := gocv.IMEncode(gocv.JPEGFileExt, *frame)
+			if err != nil {
+				log.Printf("Failed to encode frame for streaming: %v\n", err)
+			} else {
+				stream.UpdateJPEG(buf.GetBytes())
+				buf.Close()
+			}
+		}
+
+		pool.Put(frame)
+
+		if window != nil {
+			key := window.WaitKey(10)
+			switch key {
+			case 27, 113: // ESC or Q key to exit
+				quit()
+				return
+			case 97: // "A" key decreses blendOffset
+				controller.DecBlendOffset()
+			case 100: // "D" key increses blendOffset
+				controller.IncBlendOffset()
+			case 32: // Spacebar key to togle freeze frame
+				controller.ToggleFreezeFrame()
+			case 102: // "F" key toggles optical-flow motion mode
+				controller.ToggleFlowMode()
+			}
+		}
+	}
+}